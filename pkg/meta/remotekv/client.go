@@ -0,0 +1,262 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package remotekv
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/juicedata/juicefs/pkg/meta/remotekv/pb"
+)
+
+// ErrConflict carries codes.Aborted, the gRPC code under which the
+// server reports a transaction it aborted, e.g. because a read was
+// invalidated by a concurrent writer. Client.Txn retries the closure
+// itself on that code; once its retries are used up it returns the
+// last Aborted status, whose message is the server's error text rather
+// than ErrConflict's, so match it by status.Code, not by value.
+var ErrConflict = status.Error(codes.Aborted, "conflict")
+
+// Client implements a tkvClient-shaped interface on top of a remotekv
+// server, so pkg/meta can treat a remote KV store exactly like a local
+// leveldb/rocksdb/badger one.
+type Client struct {
+	conn *grpc.ClientConn
+	kv   pb.KVClient
+}
+
+// Dial connects to a remotekv server listening on addr (host:port).
+// Every call made through the returned Client carries pb's gob content
+// subtype by default, so the server (which has no special setup of its
+// own -- grpc-go picks a codec per incoming call based on this) decodes
+// with the same codec the request was encoded with.
+func Dial(addr string) (*Client, error) {
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(pb.CodecName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, kv: pb.NewKVClient(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) Get(key []byte) []byte {
+	reply, err := c.kv.Get(context.Background(), &pb.GetRequest{Key: key})
+	if err != nil {
+		panic(err)
+	}
+	return reply.Value
+}
+
+func (c *Client) Gets(keys ...[]byte) [][]byte {
+	reply, err := c.kv.BatchGet(context.Background(), &pb.BatchGetRequest{Keys: keys})
+	if err != nil {
+		panic(err)
+	}
+	return reply.Values
+}
+
+func (c *Client) ScanRange(begin, end []byte) map[string][]byte {
+	reply, err := c.kv.ScanRange(context.Background(), &pb.ScanRangeRequest{Begin: begin, End: end})
+	if err != nil {
+		panic(err)
+	}
+	ret := make(map[string][]byte, len(reply.Keys))
+	for i, k := range reply.Keys {
+		ret[string(k)] = reply.Values[i]
+	}
+	return ret
+}
+
+func (c *Client) Exist(prefix []byte) bool {
+	reply, err := c.kv.Exist(context.Background(), &pb.ExistRequest{Prefix: prefix})
+	if err != nil {
+		panic(err)
+	}
+	return reply.Ok
+}
+
+func (c *Client) Set(key, value []byte) {
+	if _, err := c.kv.Set(context.Background(), &pb.SetRequest{Key: key, Value: value}); err != nil {
+		panic(err)
+	}
+}
+
+func (c *Client) Append(key []byte, value []byte) []byte {
+	reply, err := c.kv.Append(context.Background(), &pb.AppendRequest{Key: key, Value: value})
+	if err != nil {
+		panic(err)
+	}
+	return reply.Value
+}
+
+func (c *Client) IncrBy(key []byte, value int64) int64 {
+	reply, err := c.kv.IncrBy(context.Background(), &pb.IncrByRequest{Key: key, Value: value})
+	if err != nil {
+		panic(err)
+	}
+	return reply.Value
+}
+
+func (c *Client) Dels(keys ...[]byte) {
+	if _, err := c.kv.Dels(context.Background(), &pb.DelsRequest{Keys: keys}); err != nil {
+		panic(err)
+	}
+}
+
+const txnRetries = 50
+
+// Txn streams f's operations to the server, which runs them against a
+// single non-retrying server-side transaction (Server.Txn uses
+// Local.TxnOnce). Since every op for this attempt has already been
+// drained off the stream by the time a conflict can be detected, there
+// is nothing left to replay on that stream -- so on conflict, Txn opens
+// a brand new stream and calls f again from scratch, up to txnRetries
+// times, matching the leveldb/badger/memkv backends' txn(f) contract of
+// retrying the whole closure.
+func (c *Client) Txn(f func(tx KVTxn) error) error {
+	var err error
+	for i := 0; i < txnRetries; i++ {
+		if err = c.runTxn(f); status.Code(err) != codes.Aborted {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Client) runTxn(f func(tx KVTxn) error) error {
+	stream, err := c.kv.Txn(context.Background())
+	if err != nil {
+		return err
+	}
+	tx := &txn{stream: stream}
+	if err := f(tx); err != nil {
+		return err
+	}
+	if tx.err != nil {
+		return tx.err
+	}
+	if err := stream.Send(&pb.TxnOp{Commit: true}); err != nil {
+		return err
+	}
+	result, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return status.Error(codes.Aborted, result.Error)
+	}
+	return nil
+}
+
+// txn implements KVTxn by round-tripping each operation over the Txn
+// stream; the first error seen is latched in err and surfaced once the
+// closure returns, since kvTxn's methods don't return errors themselves.
+type txn struct {
+	stream pb.KV_TxnClient
+	err    error
+}
+
+func (t *txn) call(op *pb.TxnOp) *pb.TxnResult {
+	if t.err != nil {
+		return &pb.TxnResult{}
+	}
+	if err := t.stream.Send(op); err != nil {
+		t.err = err
+		return &pb.TxnResult{}
+	}
+	result, err := t.stream.Recv()
+	if err == io.EOF {
+		t.err = io.ErrUnexpectedEOF
+		return &pb.TxnResult{}
+	}
+	if err != nil {
+		t.err = err
+		return &pb.TxnResult{}
+	}
+	if result.Error != "" {
+		t.err = status.Error(codes.Aborted, result.Error)
+		return &pb.TxnResult{}
+	}
+	return result
+}
+
+func (t *txn) Get(key []byte) []byte {
+	r := t.call(&pb.TxnOp{Get: &pb.GetRequest{Key: key}})
+	if r.Get == nil {
+		return nil
+	}
+	return r.Get.Value
+}
+
+func (t *txn) Gets(keys ...[]byte) [][]byte {
+	r := t.call(&pb.TxnOp{Gets: &pb.BatchGetRequest{Keys: keys}})
+	if r.Gets == nil {
+		return make([][]byte, len(keys))
+	}
+	return r.Gets.Values
+}
+
+func (t *txn) ScanRange(begin, end []byte) map[string][]byte {
+	r := t.call(&pb.TxnOp{ScanRange: &pb.ScanRangeRequest{Begin: begin, End: end}})
+	ret := make(map[string][]byte)
+	if r.ScanRange == nil {
+		return ret
+	}
+	for i, k := range r.ScanRange.Keys {
+		ret[string(k)] = r.ScanRange.Values[i]
+	}
+	return ret
+}
+
+func (t *txn) Exist(prefix []byte) bool {
+	r := t.call(&pb.TxnOp{Exist: &pb.ExistRequest{Prefix: prefix}})
+	return r.Exist != nil && r.Exist.Ok
+}
+
+func (t *txn) Set(key, value []byte) {
+	t.call(&pb.TxnOp{Set: &pb.SetRequest{Key: key, Value: value}})
+}
+
+func (t *txn) Append(key []byte, value []byte) []byte {
+	r := t.call(&pb.TxnOp{Append: &pb.AppendRequest{Key: key, Value: value}})
+	if r.Append == nil {
+		return nil
+	}
+	return r.Append.Value
+}
+
+func (t *txn) IncrBy(key []byte, value int64) int64 {
+	r := t.call(&pb.TxnOp{IncrBy: &pb.IncrByRequest{Key: key, Value: value}})
+	if r.IncrBy == nil {
+		return 0
+	}
+	return r.IncrBy.Value
+}
+
+func (t *txn) Dels(keys ...[]byte) {
+	t.call(&pb.TxnOp{Dels: &pb.DelsRequest{Keys: keys}})
+}
@@ -0,0 +1,180 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package remotekv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/juicedata/juicefs/pkg/meta/remotekv/pb"
+)
+
+// memLocal is a tiny in-memory Local for exercising Client/Server
+// end-to-end without pulling in a real tkvClient backend.
+type memLocal struct {
+	mu sync.Mutex
+	kv map[string][]byte
+}
+
+func newMemLocal() *memLocal {
+	return &memLocal{kv: make(map[string][]byte)}
+}
+
+func (m *memLocal) Txn(f func(tx KVTxn) error) error {
+	return m.TxnOnce(f)
+}
+
+func (m *memLocal) TxnOnce(f func(tx KVTxn) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return f(&memLocalTxn{m})
+}
+
+type memLocalTxn struct {
+	m *memLocal
+}
+
+func (t *memLocalTxn) Get(key []byte) []byte { return t.m.kv[string(key)] }
+
+func (t *memLocalTxn) Gets(keys ...[]byte) [][]byte {
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = t.Get(k)
+	}
+	return values
+}
+
+func (t *memLocalTxn) ScanRange(begin, end []byte) map[string][]byte {
+	ret := make(map[string][]byte)
+	for k, v := range t.m.kv {
+		if bytes.Compare([]byte(k), begin) >= 0 && bytes.Compare([]byte(k), end) < 0 {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+func (t *memLocalTxn) Exist(prefix []byte) bool {
+	for k := range t.m.kv {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *memLocalTxn) Set(key, value []byte) { t.m.kv[string(key)] = append([]byte{}, value...) }
+
+func (t *memLocalTxn) Append(key []byte, value []byte) []byte {
+	new := append(t.Get(key), value...)
+	t.Set(key, new)
+	return new
+}
+
+func (t *memLocalTxn) IncrBy(key []byte, value int64) int64 {
+	var n int64
+	if buf := t.Get(key); len(buf) == 8 {
+		n = int64(binary.BigEndian.Uint64(buf))
+	}
+	if value != 0 {
+		n += value
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(n))
+		t.Set(key, buf)
+	}
+	return n
+}
+
+func (t *memLocalTxn) Dels(keys ...[]byte) {
+	for _, k := range keys {
+		delete(t.m.kv, string(k))
+	}
+}
+
+func dialBufconn(t *testing.T, srv *Server) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterKVServer(s, srv)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(pb.CodecName)),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &Client{conn: conn, kv: pb.NewKVClient(conn)}
+}
+
+func TestClientServerRoundTrip(t *testing.T) {
+	c := dialBufconn(t, NewServer(newMemLocal()))
+
+	c.Set([]byte("a"), []byte("1"))
+	if v := c.Get([]byte("a")); !bytes.Equal(v, []byte("1")) {
+		t.Fatalf("Get(a) = %q, want 1", v)
+	}
+	if v := c.Get([]byte("missing")); v != nil {
+		t.Fatalf("Get(missing) = %q, want nil", v)
+	}
+	if !c.Exist([]byte("a")) {
+		t.Fatalf("Exist(a) = false, want true")
+	}
+	c.Dels([]byte("a"))
+	if c.Exist([]byte("a")) {
+		t.Fatalf("Exist(a) = true after Dels, want false")
+	}
+}
+
+func TestClientServerTxn(t *testing.T) {
+	c := dialBufconn(t, NewServer(newMemLocal()))
+
+	err := c.Txn(func(tx KVTxn) error {
+		tx.Set([]byte("x"), []byte("1"))
+		tx.Set([]byte("y"), []byte("2"))
+		if v := tx.Get([]byte("x")); !bytes.Equal(v, []byte("1")) {
+			return errors.New("unexpected value for x")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Txn: %s", err)
+	}
+
+	if v := c.Get([]byte("x")); !bytes.Equal(v, []byte("1")) {
+		t.Fatalf("Get(x) after Txn = %q, want 1", v)
+	}
+	if v := c.Get([]byte("y")); !bytes.Equal(v, []byte("2")) {
+		t.Fatalf("Get(y) after Txn = %q, want 2", v)
+	}
+}
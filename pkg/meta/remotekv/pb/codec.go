@@ -0,0 +1,62 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the gRPC content-subtype this package's messages are
+// carried under; remotekv.Dial selects it with grpc.CallContentSubtype
+// so every RPC on that connection uses gobCodec below instead of
+// grpc-go's default "proto" codec.
+const CodecName = "remotekvgob"
+
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+// gobCodec implements encoding.Codec using encoding/gob rather than
+// real protobuf wire format. The types in this package aren't actual
+// protoc-gen-go output -- generating and vendoring that requires a
+// protoc toolchain this module doesn't carry -- so they don't satisfy
+// proto.Message and can't go through grpc's default "proto" codec,
+// which type-asserts every message before marshaling. gob round-trips
+// these plain structs (including the nil-able pointer fields TxnOp and
+// TxnResult use to emulate a oneof) without that requirement, at the
+// cost of only talking to other Go processes built from this package.
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return CodecName }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("remotekv: encode %T: %w", v, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return fmt.Errorf("remotekv: decode %T: %w", v, err)
+	}
+	return nil
+}
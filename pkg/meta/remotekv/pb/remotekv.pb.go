@@ -0,0 +1,104 @@
+// Package pb defines the wire types for remotekv.proto by hand. This
+// module has no protoc/protoc-gen-go toolchain available to generate
+// real proto.Message implementations from that schema, so these are
+// plain Go structs shaped to match it field-for-field instead -- they
+// do NOT implement proto.Message and must not be sent through grpc's
+// default "proto" codec. See codec.go: remotekv.Dial selects gobCodec
+// via grpc.CallContentSubtype so these go out as gob, not protobuf.
+// If a real protoc toolchain ever becomes available, regenerate this
+// file and remotekv_grpc.pb.go from remotekv.proto and delete codec.go.
+package pb
+
+type GetRequest struct {
+	Key []byte `protobuf:"bytes,1,opt,name=key,proto3"`
+}
+
+type GetReply struct {
+	Value []byte `protobuf:"bytes,1,opt,name=value,proto3"`
+}
+
+type BatchGetRequest struct {
+	Keys [][]byte `protobuf:"bytes,1,rep,name=keys,proto3"`
+}
+
+type BatchGetReply struct {
+	Values [][]byte `protobuf:"bytes,1,rep,name=values,proto3"`
+}
+
+type ScanRangeRequest struct {
+	Begin []byte `protobuf:"bytes,1,opt,name=begin,proto3"`
+	End   []byte `protobuf:"bytes,2,opt,name=end,proto3"`
+}
+
+type ScanRangeReply struct {
+	Keys   [][]byte `protobuf:"bytes,1,rep,name=keys,proto3"`
+	Values [][]byte `protobuf:"bytes,2,rep,name=values,proto3"`
+}
+
+type ExistRequest struct {
+	Prefix []byte `protobuf:"bytes,1,opt,name=prefix,proto3"`
+}
+
+type ExistReply struct {
+	Ok bool `protobuf:"varint,1,opt,name=ok,proto3"`
+}
+
+type SetRequest struct {
+	Key   []byte `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+type SetReply struct{}
+
+type AppendRequest struct {
+	Key   []byte `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+type AppendReply struct {
+	Value []byte `protobuf:"bytes,1,opt,name=value,proto3"`
+}
+
+type IncrByRequest struct {
+	Key   []byte `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value int64  `protobuf:"varint,2,opt,name=value,proto3"`
+}
+
+type IncrByReply struct {
+	Value int64 `protobuf:"varint,1,opt,name=value,proto3"`
+}
+
+type DelsRequest struct {
+	Keys [][]byte `protobuf:"bytes,1,rep,name=keys,proto3"`
+}
+
+type DelsReply struct{}
+
+// TxnOp is one operation sent by the client inside a Txn stream; exactly
+// one of the fields below is set.
+type TxnOp struct {
+	Get       *GetRequest       `protobuf:"bytes,1,opt,name=get,proto3"`
+	Gets      *BatchGetRequest  `protobuf:"bytes,2,opt,name=gets,proto3"`
+	ScanRange *ScanRangeRequest `protobuf:"bytes,3,opt,name=scan_range,proto3"`
+	Exist     *ExistRequest     `protobuf:"bytes,4,opt,name=exist,proto3"`
+	Set       *SetRequest       `protobuf:"bytes,5,opt,name=set,proto3"`
+	Append    *AppendRequest    `protobuf:"bytes,6,opt,name=append,proto3"`
+	IncrBy    *IncrByRequest    `protobuf:"bytes,7,opt,name=incr_by,proto3"`
+	Dels      *DelsRequest      `protobuf:"bytes,8,opt,name=dels,proto3"`
+	Commit    bool              `protobuf:"varint,9,opt,name=commit,proto3"`
+}
+
+// TxnResult is the matching reply for one TxnOp; exactly one of the
+// fields below is set, with Error/Committed terminating the stream.
+type TxnResult struct {
+	Get       *GetReply       `protobuf:"bytes,1,opt,name=get,proto3"`
+	Gets      *BatchGetReply  `protobuf:"bytes,2,opt,name=gets,proto3"`
+	ScanRange *ScanRangeReply `protobuf:"bytes,3,opt,name=scan_range,proto3"`
+	Exist     *ExistReply     `protobuf:"bytes,4,opt,name=exist,proto3"`
+	Set       *SetReply       `protobuf:"bytes,5,opt,name=set,proto3"`
+	Append    *AppendReply    `protobuf:"bytes,6,opt,name=append,proto3"`
+	IncrBy    *IncrByReply    `protobuf:"bytes,7,opt,name=incr_by,proto3"`
+	Dels      *DelsReply      `protobuf:"bytes,8,opt,name=dels,proto3"`
+	Error     string          `protobuf:"bytes,9,opt,name=error,proto3"`
+	Committed bool            `protobuf:"varint,10,opt,name=committed,proto3"`
+}
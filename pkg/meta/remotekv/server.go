@@ -0,0 +1,230 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package remotekv exposes a local tkvClient over gRPC so several
+// JuiceFS clients can share a single embedded meta KV store.
+package remotekv
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/juicedata/juicefs/pkg/meta/remotekv/pb"
+)
+
+// KVTxn is the minimal subset of pkg/meta's kvTxn that the server needs;
+// it's duplicated here to avoid an import cycle with pkg/meta, which
+// depends on this package for the remotekv backend.
+type KVTxn interface {
+	Get(key []byte) []byte
+	Gets(keys ...[]byte) [][]byte
+	ScanRange(begin, end []byte) map[string][]byte
+	Exist(prefix []byte) bool
+	Set(key, value []byte)
+	Append(key []byte, value []byte) []byte
+	IncrBy(key []byte, value int64) int64
+	Dels(keys ...[]byte)
+}
+
+// Local is a local KV store that can run a closure inside a single
+// transaction, e.g. pkg/meta's tkvClient.
+type Local interface {
+	// Txn may retry f internally on conflict; used for the unary RPCs
+	// below, which complete in one round trip so a retry is invisible
+	// to the caller.
+	Txn(f func(tx KVTxn) error) error
+
+	// TxnOnce runs f exactly once and never retries. The streaming Txn
+	// RPC must use this: its ops are read live off the client's stream,
+	// so replaying f would have to re-read already-consumed stream
+	// messages that will never arrive again. Callers that need a retry
+	// (the remotekv client) re-issue a fresh RPC instead.
+	TxnOnce(f func(tx KVTxn) error) error
+}
+
+// Server implements pb.KVServer by running each RPC against a Local
+// store, wrapping every Txn stream in one Local.TxnOnce closure so the
+// client's ops are applied atomically and conflicts surface as a
+// retryable gRPC status.
+type Server struct {
+	pb.UnimplementedKVServer
+	db Local
+}
+
+func NewServer(db Local) *Server {
+	return &Server{db: db}
+}
+
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (reply *pb.GetReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		reply = &pb.GetReply{Value: tx.Get(req.Key)}
+		return nil
+	})
+	return
+}
+
+func (s *Server) BatchGet(ctx context.Context, req *pb.BatchGetRequest) (reply *pb.BatchGetReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		reply = &pb.BatchGetReply{Values: tx.Gets(req.Keys...)}
+		return nil
+	})
+	return
+}
+
+func (s *Server) ScanRange(ctx context.Context, req *pb.ScanRangeRequest) (reply *pb.ScanRangeReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		kvs := tx.ScanRange(req.Begin, req.End)
+		reply = &pb.ScanRangeReply{Keys: make([][]byte, 0, len(kvs)), Values: make([][]byte, 0, len(kvs))}
+		for k, v := range kvs {
+			reply.Keys = append(reply.Keys, []byte(k))
+			reply.Values = append(reply.Values, v)
+		}
+		return nil
+	})
+	return
+}
+
+func (s *Server) Exist(ctx context.Context, req *pb.ExistRequest) (reply *pb.ExistReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		reply = &pb.ExistReply{Ok: tx.Exist(req.Prefix)}
+		return nil
+	})
+	return
+}
+
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetReply, error) {
+	err := s.db.Txn(func(tx KVTxn) error {
+		tx.Set(req.Key, req.Value)
+		return nil
+	})
+	return &pb.SetReply{}, err
+}
+
+func (s *Server) Append(ctx context.Context, req *pb.AppendRequest) (reply *pb.AppendReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		reply = &pb.AppendReply{Value: tx.Append(req.Key, req.Value)}
+		return nil
+	})
+	return
+}
+
+func (s *Server) IncrBy(ctx context.Context, req *pb.IncrByRequest) (reply *pb.IncrByReply, err error) {
+	err = s.db.Txn(func(tx KVTxn) error {
+		reply = &pb.IncrByReply{Value: tx.IncrBy(req.Key, req.Value)}
+		return nil
+	})
+	return
+}
+
+func (s *Server) Dels(ctx context.Context, req *pb.DelsRequest) (*pb.DelsReply, error) {
+	err := s.db.Txn(func(tx KVTxn) error {
+		tx.Dels(req.Keys...)
+		return nil
+	})
+	return &pb.DelsReply{}, err
+}
+
+// Txn runs the whole RPC stream inside a single Local.TxnOnce closure:
+// each TxnOp read from the stream is applied to tx and its TxnResult is
+// sent back immediately, so the client observes a consistent view for
+// the lifetime of the transaction. The result of the final commit op is
+// sent only once the backend has committed. A conflict (or any other
+// error) from TxnOnce is sent back as an error result and aborts the
+// stream with a codes.Aborted status; since every op in this attempt
+// has already been drained from the stream, the backend must not retry
+// internally (there's nothing left to re-read) -- the client opens a
+// fresh stream and replays its ops from scratch instead.
+func (s *Server) Txn(stream pb.KV_TxnServer) error {
+	committed := false
+	err := s.db.TxnOnce(func(tx KVTxn) error {
+		for {
+			op, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			result, done, err := applyOp(tx, op)
+			if err != nil {
+				return err
+			}
+			if done {
+				committed = true
+				return nil
+			}
+			if err := stream.Send(result); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		_ = stream.Send(&pb.TxnResult{Error: err.Error()})
+		return status.Error(codes.Aborted, err.Error())
+	}
+	if committed {
+		return stream.Send(&pb.TxnResult{Committed: true})
+	}
+	return nil
+}
+
+func applyOp(tx KVTxn, op *pb.TxnOp) (result *pb.TxnResult, done bool, err error) {
+	switch {
+	case op.Get != nil:
+		return &pb.TxnResult{Get: &pb.GetReply{Value: tx.Get(op.Get.Key)}}, false, nil
+	case op.Gets != nil:
+		return &pb.TxnResult{Gets: &pb.BatchGetReply{Values: tx.Gets(op.Gets.Keys...)}}, false, nil
+	case op.ScanRange != nil:
+		kvs := tx.ScanRange(op.ScanRange.Begin, op.ScanRange.End)
+		reply := &pb.ScanRangeReply{Keys: make([][]byte, 0, len(kvs)), Values: make([][]byte, 0, len(kvs))}
+		for k, v := range kvs {
+			reply.Keys = append(reply.Keys, []byte(k))
+			reply.Values = append(reply.Values, v)
+		}
+		return &pb.TxnResult{ScanRange: reply}, false, nil
+	case op.Exist != nil:
+		return &pb.TxnResult{Exist: &pb.ExistReply{Ok: tx.Exist(op.Exist.Prefix)}}, false, nil
+	case op.Set != nil:
+		tx.Set(op.Set.Key, op.Set.Value)
+		return &pb.TxnResult{Set: &pb.SetReply{}}, false, nil
+	case op.Append != nil:
+		return &pb.TxnResult{Append: &pb.AppendReply{Value: tx.Append(op.Append.Key, op.Append.Value)}}, false, nil
+	case op.IncrBy != nil:
+		return &pb.TxnResult{IncrBy: &pb.IncrByReply{Value: tx.IncrBy(op.IncrBy.Key, op.IncrBy.Value)}}, false, nil
+	case op.Dels != nil:
+		tx.Dels(op.Dels.Keys...)
+		return &pb.TxnResult{Dels: &pb.DelsReply{}}, false, nil
+	default:
+		return &pb.TxnResult{Committed: true}, true, nil
+	}
+}
+
+// Serve is a small convenience wrapper for the remotekv server binary:
+// it registers srv on a fresh *grpc.Server and blocks serving on addr
+// until the listener fails or the process is killed.
+func Serve(addr string, srv *Server) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	pb.RegisterKVServer(s, srv)
+	return s.Serve(lis)
+}
@@ -0,0 +1,231 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func init() {
+	Register("badger", newKVMeta)
+}
+
+const (
+	badgerTxnRetries   = 50
+	badgerGCInterval   = time.Minute
+	badgerGCDiscardPct = 0.5
+)
+
+func newBadgerClient(addr string) (tkvClient, error) {
+	addr, prefix := splitPrefix(addr)
+	opts := badger.DefaultOptions(addr)
+	opts = opts.WithLoggingLevel(badger.WARNING)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	bc := &badgerClient{db: db, stopGC: make(chan struct{})}
+	go bc.runGC()
+	var c tkvClient = bc
+	if prefix != nil {
+		c = withPrefix(c, prefix)
+	}
+	return withThrottle(c, currentThrottle()), nil
+}
+
+type badgerClient struct {
+	db     *badger.DB
+	stopGC chan struct{}
+}
+
+func (c *badgerClient) runGC() {
+	ticker := time.NewTicker(badgerGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopGC:
+			return
+		case <-ticker.C:
+		again:
+			if err := c.db.RunValueLogGC(badgerGCDiscardPct); err == nil {
+				goto again
+			}
+		}
+	}
+}
+
+func (c *badgerClient) name() string {
+	return "badger"
+}
+
+// Close stops the value-log GC goroutine and closes the underlying
+// database; it should be called once on shutdown.
+func (c *badgerClient) Close() error {
+	close(c.stopGC)
+	return c.db.Close()
+}
+
+func (c *badgerClient) txn(f func(kvTxn) error) error {
+	var err error
+	for i := 0; i < badgerTxnRetries; i++ {
+		if err = c.txnOnce(f); err != badger.ErrConflict {
+			break
+		}
+	}
+	return err
+}
+
+// txnOnce runs f exactly once, without retrying on conflict; see
+// leveldbClient.txnOnce for why callers like the remotekv server need
+// this instead of txn.
+func (c *badgerClient) txnOnce(f func(kvTxn) error) error {
+	return c.db.Update(func(txn *badger.Txn) error {
+		tx := &badgerTxn{client: c, txn: txn}
+		return f(tx)
+	})
+}
+
+type badgerTxn struct {
+	client *badgerClient
+	txn    *badger.Txn
+}
+
+func (tx *badgerTxn) get(key []byte) []byte {
+	item, err := tx.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (tx *badgerTxn) gets(keys ...[]byte) [][]byte {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = tx.get(key)
+	}
+	return values
+}
+
+func (tx *badgerTxn) scanRange0(begin, end []byte, filter func(k, v []byte) bool) map[string][]byte {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	it := tx.txn.NewIterator(opts)
+	defer it.Close()
+	ret := make(map[string][]byte)
+	for it.Seek(begin); it.Valid(); it.Next() {
+		item := it.Item()
+		key := item.KeyCopy(nil)
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			break
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			panic(err)
+		}
+		if filter == nil || filter(key, value) {
+			ret[string(key)] = value
+		}
+	}
+	return ret
+}
+
+func (tx *badgerTxn) scanRange(begin, end []byte) map[string][]byte {
+	return tx.scanRange0(begin, end, nil)
+}
+
+func (tx *badgerTxn) nextKey(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	next := make([]byte, len(key))
+	copy(next, key)
+	p := len(next) - 1
+	for {
+		next[p]++
+		if next[p] != 0 {
+			break
+		}
+		p--
+		if p < 0 {
+			panic("can't scan keys for 0xFF")
+		}
+	}
+	return next
+}
+
+func (tx *badgerTxn) scanKeys(prefix []byte) [][]byte {
+	var keys [][]byte
+	for k := range tx.scanValues(prefix, nil) {
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+func (tx *badgerTxn) scanValues(prefix []byte, filter func(k, v []byte) bool) map[string][]byte {
+	return tx.scanRange0(prefix, tx.nextKey(prefix), filter)
+}
+
+func (tx *badgerTxn) exist(prefix []byte) bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := tx.txn.NewIterator(opts)
+	defer it.Close()
+	it.Seek(prefix)
+	return it.ValidForPrefix(prefix)
+}
+
+func (tx *badgerTxn) set(key, value []byte) {
+	if err := tx.txn.Set(key, value); err != nil {
+		panic(err)
+	}
+}
+
+func (tx *badgerTxn) append(key []byte, value []byte) []byte {
+	new := append(tx.get(key), value...)
+	tx.set(key, new)
+	return new
+}
+
+func (tx *badgerTxn) incrBy(key []byte, value int64) int64 {
+	var new int64
+	buf := tx.get(key)
+	if len(buf) > 0 {
+		new = parseCounter(buf)
+	}
+	if value != 0 {
+		new += value
+		tx.set(key, packCounter(new))
+	}
+	return new
+}
+
+func (tx *badgerTxn) dels(keys ...[]byte) {
+	for _, key := range keys {
+		if err := tx.txn.Delete(key); err != nil {
+			panic(err)
+		}
+	}
+}
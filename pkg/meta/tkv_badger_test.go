@@ -0,0 +1,148 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestBadgerRoundTrip(t *testing.T) {
+	c, err := newBadgerClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("open badger: %s", err)
+	}
+	defer c.(*badgerClient).Close()
+
+	if err := c.txn(func(tx kvTxn) error {
+		tx.set([]byte("a"), []byte("1"))
+		tx.set([]byte("b"), []byte("2"))
+		tx.set([]byte("c"), []byte("3"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		if v := tx.get([]byte("a")); !bytes.Equal(v, []byte("1")) {
+			t.Errorf("get a = %q, want 1", v)
+		}
+		if v := tx.get([]byte("missing")); v != nil {
+			t.Errorf("get missing = %q, want nil", v)
+		}
+		kvs := tx.scanRange([]byte("a"), []byte("c"))
+		if len(kvs) != 2 {
+			t.Errorf("scanRange got %d entries, want 2", len(kvs))
+		}
+		if !tx.exist([]byte("b")) {
+			t.Errorf("exist(b) = false, want true")
+		}
+		tx.dels([]byte("b"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		if tx.exist([]byte("b")) {
+			t.Errorf("exist(b) = true after dels, want false")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+}
+
+func TestBadgerAppendAndIncrBy(t *testing.T) {
+	c, err := newBadgerClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("open badger: %s", err)
+	}
+	defer c.(*badgerClient).Close()
+
+	key := []byte("log")
+	if err := c.txn(func(tx kvTxn) error {
+		tx.append(key, []byte("a"))
+		tx.append(key, []byte("b"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if err := c.txn(func(tx kvTxn) error {
+		if v := tx.get(key); !bytes.Equal(v, []byte("ab")) {
+			t.Errorf("get log = %q, want ab", v)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	counter := []byte("counter")
+	const goroutines = 20
+	const incrPerGoroutine = 20
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrPerGoroutine; j++ {
+				if err := c.txn(func(tx kvTxn) error {
+					tx.incrBy(counter, 1)
+					return nil
+				}); err != nil {
+					t.Errorf("txn: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got int64
+	if err := c.txn(func(tx kvTxn) error {
+		got = tx.incrBy(counter, 0)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if want := int64(goroutines * incrPerGoroutine); got != want {
+		t.Fatalf("counter = %d, want %d", got, want)
+	}
+}
+
+// TestBadgerCloseThroughWrappers guards against Close becoming
+// unreachable once a badgerClient is wrapped by withPrefix/withThrottle
+// (as any prefixed or throttled volume's backend is): the concrete
+// value returned to callers is then *prefixClient/*throttledClient,
+// neither of which is a *badgerClient, so Close has to be threaded
+// through both wrapper types to still reach the GC goroutine and db
+// handle underneath.
+func TestBadgerCloseThroughWrappers(t *testing.T) {
+	base, err := newBadgerClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("open badger: %s", err)
+	}
+	wrapped := withThrottle(withPrefix(base, []byte("vol1/")), &Throttle{ReadQPS: 1000})
+
+	closer, ok := wrapped.(io.Closer)
+	if !ok {
+		t.Fatalf("%T does not implement io.Closer", wrapped)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+}
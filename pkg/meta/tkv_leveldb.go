@@ -19,7 +19,9 @@ package meta
 
 import (
 	"bytes"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/jmhodges/levigo"
 )
@@ -28,12 +30,28 @@ func init() {
 	Register("leveldb", newKVMeta)
 }
 
+// ErrLdbConflict is returned by leveldbClient.txn when a key read during
+// the transaction was modified by another writer before commit; callers
+// should retry the whole closure, the same as they would on a conflict
+// from the rocksdb OptimisticTransactionDB backend.
+var ErrLdbConflict = errors.New("leveldb: transaction conflict, please retry")
+
+const ldbTxnRetries = 50
+
 func newLeveldbClient(addr string) (tkvClient, error) {
+	addr, prefix := splitPrefix(addr)
 	opts := levigo.NewOptions()
 	opts.SetCache(levigo.NewLRUCache(4 << 20))
 	opts.SetCreateIfMissing(true)
 	ldb, err := levigo.Open(addr, opts)
-	return &leveldbClient{ldb: ldb}, err
+	if err != nil {
+		return nil, err
+	}
+	var c tkvClient = &leveldbClient{ldb: ldb}
+	if prefix != nil {
+		c = withPrefix(c, prefix)
+	}
+	return withThrottle(c, currentThrottle()), nil
 }
 
 type leveldbClient struct {
@@ -46,6 +64,21 @@ type ldbTxn struct {
 	ro     *levigo.ReadOptions
 	wo     *levigo.WriteOptions
 	wb     *levigo.WriteBatch
+	reads  map[string][]byte // key -> value observed through the snapshot
+}
+
+// trackRead records the first value observed for key during the
+// transaction, so commit can detect whether it was changed by a
+// concurrent writer since.
+func (tx *ldbTxn) trackRead(key, value []byte) {
+	k := string(key)
+	if _, ok := tx.reads[k]; ok {
+		return
+	}
+	if tx.reads == nil {
+		tx.reads = make(map[string][]byte)
+	}
+	tx.reads[k] = value
 }
 
 func (tx *ldbTxn) get(key []byte) []byte {
@@ -54,8 +87,9 @@ func (tx *ldbTxn) get(key []byte) []byte {
 		panic(err)
 	}
 	if len(value) == 0 {
-		return nil
+		value = nil
 	}
+	tx.trackRead(key, value)
 	return value
 }
 
@@ -171,6 +205,31 @@ func (c *leveldbClient) name() string {
 }
 
 func (c *leveldbClient) txn(f func(kvTxn) error) error {
+	var err error
+	for i := 0; i < ldbTxnRetries; i++ {
+		if err = c.runTxn(f); err != ErrLdbConflict {
+			return err
+		}
+		time.Sleep(time.Millisecond * time.Duration(i+1))
+	}
+	return err
+}
+
+// txnOnce runs f exactly once, without retrying on conflict. Callers
+// that need to own the retry loop themselves -- the remotekv server,
+// which can't safely re-drive a closure that reads from an in-flight
+// gRPC stream -- use this instead of txn.
+func (c *leveldbClient) txnOnce(f func(kvTxn) error) error {
+	return c.runTxn(f)
+}
+
+// runTxn executes f once against a fresh snapshot and, on success,
+// commits it: the write batch is applied only if every key read
+// through the snapshot still holds the same value, checked under a
+// short critical section. If any read-set key changed since the
+// snapshot was taken, the attempt aborts with ErrLdbConflict so txn can
+// retry the closure.
+func (c *leveldbClient) runTxn(f func(kvTxn) error) error {
 	ro := levigo.NewReadOptions()
 	wo := levigo.NewWriteOptions()
 	snap := c.ldb.NewSnapshot()
@@ -186,12 +245,27 @@ func (c *leveldbClient) txn(f func(kvTxn) error) error {
 		wb:     wb,
 	}
 
-	//c.Lock()
-	//defer c.Unlock()
 	if err := f(tx); err != nil {
 		return err
 	}
 
+	c.Lock()
+	defer c.Unlock()
+
+	latest := levigo.NewReadOptions()
+	for key, old := range tx.reads {
+		cur, err := c.ldb.Get(latest, []byte(key))
+		if err != nil {
+			panic(err)
+		}
+		if len(cur) == 0 {
+			cur = nil
+		}
+		if !bytes.Equal(cur, old) {
+			return ErrLdbConflict
+		}
+	}
+
 	if err := c.ldb.Write(tx.wo, tx.wb); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,62 @@
+// +build !fdb
+
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLeveldbConcurrentIncrBy(t *testing.T) {
+	c, err := newLeveldbClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("open leveldb: %s", err)
+	}
+
+	const goroutines = 50
+	const incrPerGoroutine = 20
+	key := []byte("counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrPerGoroutine; j++ {
+				if err := c.txn(func(tx kvTxn) error {
+					tx.incrBy(key, 1)
+					return nil
+				}); err != nil {
+					t.Errorf("txn: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got int64
+	if err := c.txn(func(tx kvTxn) error {
+		got = tx.incrBy(key, 0)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if want := int64(goroutines * incrPerGoroutine); got != want {
+		t.Fatalf("counter = %d, want %d", got, want)
+	}
+}
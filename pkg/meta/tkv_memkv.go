@@ -0,0 +1,239 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+func init() {
+	Register("memkv", newKVMeta)
+}
+
+// ErrMemkvConflict is returned internally when a memkv transaction's
+// read set was invalidated by a concurrent writer before commit;
+// memkvClient.txn retries the closure on it, like the leveldb backend
+// does for ErrLdbConflict.
+var ErrMemkvConflict = errors.New("memkv: transaction conflict, please retry")
+
+const memkvTxnRetries = 50
+
+// newMemKVClient returns a pure in-memory tkvClient backed by a Go
+// B-tree, so the meta layer's test suite and "juicefs format
+// memkv://..." scratch mounts can run without cgo, disk, or a running
+// Redis/TiKV. addr is ignored; every call creates a fresh, empty store.
+func newMemKVClient(addr string) (tkvClient, error) {
+	var c tkvClient = &memkvClient{tree: btree.New(32)}
+	return withThrottle(c, currentThrottle()), nil
+}
+
+type memItem struct {
+	key     []byte
+	value   []byte
+	version uint64
+}
+
+func (a *memItem) Less(b btree.Item) bool {
+	return bytes.Compare(a.key, b.(*memItem).key) < 0
+}
+
+type memkvClient struct {
+	sync.Mutex
+	tree    *btree.BTree
+	version uint64
+}
+
+func (c *memkvClient) name() string {
+	return "memkv"
+}
+
+// txn snapshots the tree with copy-on-write (btree.Clone is O(1), nodes
+// are shared until mutated), runs f against that snapshot, then swaps
+// it in under a short write lock -- retrying the whole closure if any
+// key f read has a newer version than the one it saw.
+func (c *memkvClient) txn(f func(kvTxn) error) error {
+	var err error
+	for i := 0; i < memkvTxnRetries; i++ {
+		if err = c.runTxn(f); err != ErrMemkvConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// txnOnce runs f exactly once, without retrying on conflict; see
+// leveldbClient.txnOnce for why callers like the remotekv server need
+// this instead of txn.
+func (c *memkvClient) txnOnce(f func(kvTxn) error) error {
+	return c.runTxn(f)
+}
+
+func (c *memkvClient) runTxn(f func(kvTxn) error) error {
+	c.Lock()
+	snap := c.tree.Clone()
+	c.Unlock()
+
+	tx := &memkvTxn{tree: snap, reads: make(map[string]uint64)}
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for key, version := range tx.reads {
+		if item := c.tree.Get(&memItem{key: []byte(key)}); item != nil {
+			if item.(*memItem).version != version {
+				return ErrMemkvConflict
+			}
+		} else if version != 0 {
+			return ErrMemkvConflict
+		}
+	}
+	c.version++
+	c.tree = tx.tree
+	return nil
+}
+
+type memkvTxn struct {
+	tree  *btree.BTree
+	reads map[string]uint64
+}
+
+func (tx *memkvTxn) trackRead(key []byte) uint64 {
+	k := string(key)
+	if v, ok := tx.reads[k]; ok {
+		return v
+	}
+	var version uint64
+	if item := tx.tree.Get(&memItem{key: key}); item != nil {
+		version = item.(*memItem).version
+	}
+	tx.reads[k] = version
+	return version
+}
+
+func (tx *memkvTxn) get(key []byte) []byte {
+	tx.trackRead(key)
+	item := tx.tree.Get(&memItem{key: key})
+	if item == nil {
+		return nil
+	}
+	return item.(*memItem).value
+}
+
+func (tx *memkvTxn) gets(keys ...[]byte) [][]byte {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = tx.get(key)
+	}
+	return values
+}
+
+func (tx *memkvTxn) scanRange0(begin, end []byte, filter func(k, v []byte) bool) map[string][]byte {
+	ret := make(map[string][]byte)
+	tx.tree.AscendRange(&memItem{key: begin}, &memItem{key: end}, func(i btree.Item) bool {
+		it := i.(*memItem)
+		if filter == nil || filter(it.key, it.value) {
+			ret[string(it.key)] = it.value
+		}
+		return true
+	})
+	return ret
+}
+
+func (tx *memkvTxn) scanRange(begin, end []byte) map[string][]byte {
+	return tx.scanRange0(begin, end, nil)
+}
+
+// nextKey mirrors the leveldb/rocksdb backends: key incremented as a
+// big-endian number of the same length (0x01ff -> 0x0200), which is
+// greater than every key with the given prefix; nil for an empty key,
+// and it panics on an all-0xFF key (which no caller is expected to pass).
+func (tx *memkvTxn) nextKey(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	next := make([]byte, len(key))
+	copy(next, key)
+	p := len(next) - 1
+	for {
+		next[p]++
+		if next[p] != 0 {
+			break
+		}
+		p--
+		if p < 0 {
+			panic("can't scan keys for 0xFF")
+		}
+	}
+	return next
+}
+
+func (tx *memkvTxn) scanKeys(prefix []byte) [][]byte {
+	var keys [][]byte
+	for k := range tx.scanValues(prefix, nil) {
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+func (tx *memkvTxn) scanValues(prefix []byte, filter func(k, v []byte) bool) map[string][]byte {
+	return tx.scanRange0(prefix, tx.nextKey(prefix), filter)
+}
+
+func (tx *memkvTxn) exist(prefix []byte) bool {
+	found := false
+	tx.tree.AscendGreaterOrEqual(&memItem{key: prefix}, func(i btree.Item) bool {
+		found = bytes.HasPrefix(i.(*memItem).key, prefix)
+		return false
+	})
+	return found
+}
+
+func (tx *memkvTxn) set(key, value []byte) {
+	version := tx.trackRead(key) + 1
+	tx.tree.ReplaceOrInsert(&memItem{key: append([]byte{}, key...), value: append([]byte{}, value...), version: version})
+}
+
+func (tx *memkvTxn) append(key []byte, value []byte) []byte {
+	new := append(tx.get(key), value...)
+	tx.set(key, new)
+	return new
+}
+
+func (tx *memkvTxn) incrBy(key []byte, value int64) int64 {
+	var new int64
+	buf := tx.get(key)
+	if len(buf) > 0 {
+		new = parseCounter(buf)
+	}
+	if value != 0 {
+		new += value
+		tx.set(key, packCounter(new))
+	}
+	return new
+}
+
+func (tx *memkvTxn) dels(keys ...[]byte) {
+	for _, key := range keys {
+		tx.trackRead(key)
+		tx.tree.Delete(&memItem{key: key})
+	}
+}
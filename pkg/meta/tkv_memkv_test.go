@@ -0,0 +1,173 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestMemkvRoundTrip(t *testing.T) {
+	c, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		tx.set([]byte("a"), []byte("1"))
+		tx.set([]byte("b"), []byte("2"))
+		tx.set([]byte("c"), []byte("3"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		if v := tx.get([]byte("a")); !bytes.Equal(v, []byte("1")) {
+			t.Errorf("get a = %q, want 1", v)
+		}
+		if v := tx.get([]byte("missing")); v != nil {
+			t.Errorf("get missing = %q, want nil", v)
+		}
+		kvs := tx.scanRange([]byte("a"), []byte("c"))
+		if len(kvs) != 2 {
+			t.Errorf("scanRange got %d entries, want 2", len(kvs))
+		}
+		if !tx.exist([]byte("b")) {
+			t.Errorf("exist(b) = false, want true")
+		}
+		tx.dels([]byte("b"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		if tx.exist([]byte("b")) {
+			t.Errorf("exist(b) = true after dels, want false")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+}
+
+func TestMemkvScanKeysAndValues(t *testing.T) {
+	c, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		tx.set([]byte("d1"), []byte("x"))
+		tx.set([]byte("d2"), []byte("y"))
+		tx.set([]byte("e1"), []byte("z"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		keys := tx.scanKeys([]byte("d"))
+		if len(keys) != 2 {
+			t.Errorf("scanKeys(d) got %d keys, want 2", len(keys))
+		}
+		kvs := tx.scanValues([]byte("d"), func(k, v []byte) bool {
+			return bytes.Equal(v, []byte("x"))
+		})
+		if len(kvs) != 1 || string(kvs["d1"]) != "x" {
+			t.Errorf("scanValues(d, filter) = %v, want d1=x only", kvs)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+}
+
+func TestMemkvNextKey(t *testing.T) {
+	c, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+
+	if err := c.txn(func(tx kvTxn) error {
+		mtx := tx.(*memkvTxn)
+		if got := mtx.nextKey(nil); got != nil {
+			t.Errorf("nextKey(nil) = %v, want nil", got)
+		}
+		if got := mtx.nextKey([]byte{0x01}); !bytes.Equal(got, []byte{0x02}) {
+			t.Errorf("nextKey(0x01) = %v, want 0x02", got)
+		}
+		if got := mtx.nextKey([]byte{0x01, 0xff}); !bytes.Equal(got, []byte{0x02, 0x00}) {
+			t.Errorf("nextKey(0x01ff) = %v, want 0x0200", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("nextKey(0xff) did not panic")
+		}
+	}()
+	if err := c.txn(func(tx kvTxn) error {
+		tx.(*memkvTxn).nextKey([]byte{0xff})
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+}
+
+func TestMemkvConcurrentIncrBy(t *testing.T) {
+	c, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+
+	const goroutines = 20
+	const incrPerGoroutine = 20
+	key := []byte("counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrPerGoroutine; j++ {
+				if err := c.txn(func(tx kvTxn) error {
+					tx.incrBy(key, 1)
+					return nil
+				}); err != nil {
+					t.Errorf("txn: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got int64
+	if err := c.txn(func(tx kvTxn) error {
+		got = tx.incrBy(key, 0)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if want := int64(goroutines * incrPerGoroutine); got != want {
+		t.Fatalf("counter = %d, want %d", got, want)
+	}
+}
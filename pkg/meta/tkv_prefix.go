@@ -0,0 +1,161 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// splitPrefix strips a trailing "?prefix=xxx" query parameter off addr,
+// returning the bare address and the prefix bytes (nil if none was
+// given). The leveldb, rocksdb and badger constructors call this so
+// "leveldb://path/to/db?prefix=vol1" namespaces its keys with withPrefix
+// without every backend having to parse the query string itself.
+func splitPrefix(addr string) (string, []byte) {
+	i := strings.Index(addr, "?prefix=")
+	if i < 0 {
+		return addr, nil
+	}
+	return addr[:i], []byte(addr[i+len("?prefix="):])
+}
+
+// withPrefix wraps a tkvClient and transparently namespaces every key
+// with prefix, so several JuiceFS volumes can share one embedded
+// leveldb/rocksdb/badger file without their counters or inode ranges
+// colliding. It's selected with a "?prefix=" query parameter on the
+// backend URL, e.g. "leveldb://path/to/db?prefix=vol1".
+func withPrefix(c tkvClient, prefix []byte) tkvClient {
+	return &prefixClient{c, prefix}
+}
+
+type prefixClient struct {
+	tkvClient
+	prefix []byte
+}
+
+// Close forwards to the wrapped backend's Close, if it has one (e.g.
+// badgerClient): embedding tkvClient alone doesn't promote Close, since
+// that's not part of the tkvClient interface, so without this a
+// prefixed badger client's GC goroutine and db handle could never be
+// closed by anything holding it as a plain tkvClient.
+func (c *prefixClient) Close() error {
+	if closer, ok := c.tkvClient.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *prefixClient) txn(f func(kvTxn) error) error {
+	return c.tkvClient.txn(func(tx kvTxn) error {
+		return f(&prefixTxn{tx, c.prefix})
+	})
+}
+
+// txnOnce delegates to the wrapped backend's own single-attempt
+// primitive rather than falling back to the retrying txn: a caller
+// that asked for TxnOnce (the remotekv server, mid-stream) relies on
+// never being retried, and silently handing it a retrying txn here
+// would reintroduce the stream-replay deadlock txnOnce exists to
+// prevent. If the wrapped backend has no txnOnce of its own, that's a
+// real gap in this composition, so fail loudly instead of masking it.
+func (c *prefixClient) txnOnce(f func(kvTxn) error) error {
+	once, ok := c.tkvClient.(singleAttemptTxn)
+	if !ok {
+		panic(fmt.Sprintf("prefixClient: wrapped %T does not support txnOnce", c.tkvClient))
+	}
+	return once.txnOnce(func(tx kvTxn) error {
+		return f(&prefixTxn{tx, c.prefix})
+	})
+}
+
+type prefixTxn struct {
+	kvTxn
+	prefix []byte
+}
+
+func (tx *prefixTxn) k(key []byte) []byte {
+	return append(append([]byte{}, tx.prefix...), key...)
+}
+
+func (tx *prefixTxn) strip(key []byte) []byte {
+	return key[len(tx.prefix):]
+}
+
+func (tx *prefixTxn) get(key []byte) []byte {
+	return tx.kvTxn.get(tx.k(key))
+}
+
+func (tx *prefixTxn) gets(keys ...[]byte) [][]byte {
+	pkeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		pkeys[i] = tx.k(key)
+	}
+	return tx.kvTxn.gets(pkeys...)
+}
+
+func (tx *prefixTxn) scanRange(begin, end []byte) map[string][]byte {
+	kvs := tx.kvTxn.scanRange(tx.k(begin), tx.k(end))
+	ret := make(map[string][]byte, len(kvs))
+	for k, v := range kvs {
+		ret[string(tx.strip([]byte(k)))] = v
+	}
+	return ret
+}
+
+func (tx *prefixTxn) scanKeys(prefix []byte) [][]byte {
+	var keys [][]byte
+	for k := range tx.scanValues(prefix, nil) {
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+func (tx *prefixTxn) scanValues(prefix []byte, filter func(k, v []byte) bool) map[string][]byte {
+	kvs := tx.kvTxn.scanValues(tx.k(prefix), func(k, v []byte) bool {
+		return filter == nil || filter(tx.strip(k), v)
+	})
+	ret := make(map[string][]byte, len(kvs))
+	for k, v := range kvs {
+		ret[string(tx.strip([]byte(k)))] = v
+	}
+	return ret
+}
+
+func (tx *prefixTxn) exist(prefix []byte) bool {
+	return tx.kvTxn.exist(tx.k(prefix))
+}
+
+func (tx *prefixTxn) set(key, value []byte) {
+	tx.kvTxn.set(tx.k(key), value)
+}
+
+func (tx *prefixTxn) append(key []byte, value []byte) []byte {
+	return tx.kvTxn.append(tx.k(key), value)
+}
+
+func (tx *prefixTxn) incrBy(key []byte, value int64) int64 {
+	return tx.kvTxn.incrBy(tx.k(key), value)
+}
+
+func (tx *prefixTxn) dels(keys ...[]byte) {
+	pkeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		pkeys[i] = tx.k(key)
+	}
+	tx.kvTxn.dels(pkeys...)
+}
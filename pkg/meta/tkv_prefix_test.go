@@ -0,0 +1,131 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import "testing"
+
+func TestPrefixClientIsolation(t *testing.T) {
+	base, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+	c1 := withPrefix(base, []byte("vol1/"))
+	c2 := withPrefix(base, []byte("vol2/"))
+
+	key := []byte("counter")
+	if err := c1.txn(func(tx kvTxn) error {
+		tx.incrBy(key, 3)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if err := c2.txn(func(tx kvTxn) error {
+		tx.incrBy(key, 10)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	var got1, got2 int64
+	if err := c1.txn(func(tx kvTxn) error {
+		got1 = tx.incrBy(key, 0)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if err := c2.txn(func(tx kvTxn) error {
+		got2 = tx.incrBy(key, 0)
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if got1 != 3 {
+		t.Fatalf("c1 counter = %d, want 3", got1)
+	}
+	if got2 != 10 {
+		t.Fatalf("c2 counter = %d, want 10", got2)
+	}
+
+	if err := c1.txn(func(tx kvTxn) error {
+		tx.set([]byte("a"), []byte("1"))
+		tx.set([]byte("b"), []byte("2"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if err := c2.txn(func(tx kvTxn) error {
+		tx.set([]byte("a"), []byte("x"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+
+	var kvs1, kvs2 map[string][]byte
+	if err := c1.txn(func(tx kvTxn) error {
+		kvs1 = tx.scanRange([]byte("a"), []byte("z"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if err := c2.txn(func(tx kvTxn) error {
+		kvs2 = tx.scanRange([]byte("a"), []byte("z"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	// "counter" sorts between "a" and "z", so each tenant's own counter
+	// is part of its scan too.
+	if len(kvs1) != 3 || string(kvs1["a"]) != "1" || string(kvs1["b"]) != "2" || kvs1["counter"] == nil {
+		t.Fatalf("c1 scanRange = %v, want a=1, b=2 and counter", kvs1)
+	}
+	if len(kvs2) != 2 || string(kvs2["a"]) != "x" || kvs2["counter"] == nil {
+		t.Fatalf("c2 scanRange = %v, want a=x and counter only", kvs2)
+	}
+}
+
+// TestPrefixClientTxnOnce guards against localAdapter.TxnOnce silently
+// falling back to the retrying txn for a prefixed client: prefixClient
+// must implement singleAttemptTxn itself, delegating to the wrapped
+// backend's own txnOnce, scoped to its prefix like txn is.
+func TestPrefixClientTxnOnce(t *testing.T) {
+	base, err := newMemKVClient("")
+	if err != nil {
+		t.Fatalf("open memkv: %s", err)
+	}
+	c := withPrefix(base, []byte("vol1/"))
+
+	once, ok := c.(singleAttemptTxn)
+	if !ok {
+		t.Fatalf("prefixClient does not implement singleAttemptTxn")
+	}
+	if err := once.txnOnce(func(tx kvTxn) error {
+		tx.set([]byte("k"), []byte("v"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txnOnce: %s", err)
+	}
+
+	var got []byte
+	if err := c.txn(func(tx kvTxn) error {
+		got = tx.get([]byte("k"))
+		return nil
+	}); err != nil {
+		t.Fatalf("txn: %s", err)
+	}
+	if string(got) != "v" {
+		t.Fatalf("get(k) = %q, want v", got)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"strings"
+
+	"github.com/juicedata/juicefs/pkg/meta/remotekv"
+)
+
+func init() {
+	Register("remotekv", newKVMeta)
+}
+
+// newRemotekvClient dials a remotekv server at addr, formatted as
+// "host:port/dbname" (the "remotekv://" scheme is stripped by the
+// caller); dbname is presently unused, reserved for servers that
+// multiplex several local databases behind one listener.
+func newRemotekvClient(addr string) (tkvClient, error) {
+	hostport := addr
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		hostport = addr[:i]
+	}
+	c, err := remotekv.Dial(hostport)
+	if err != nil {
+		return nil, err
+	}
+	var client tkvClient = &remotekvClient{c}
+	return withThrottle(client, currentThrottle()), nil
+}
+
+type remotekvClient struct {
+	*remotekv.Client
+}
+
+func (c *remotekvClient) name() string {
+	return "remotekv"
+}
+
+func (c *remotekvClient) txn(f func(kvTxn) error) error {
+	return c.Client.Txn(func(tx remotekv.KVTxn) error {
+		return f(&remotekvTxn{tx})
+	})
+}
+
+// remotekvTxn adapts remotekv.KVTxn (the subset of kvTxn that crosses
+// the wire) to the full kvTxn interface, deriving scanKeys/scanValues
+// and nextKey locally exactly like the leveldb/rocksdb backends do.
+type remotekvTxn struct {
+	tx remotekv.KVTxn
+}
+
+func (t *remotekvTxn) get(key []byte) []byte {
+	return t.tx.Get(key)
+}
+
+func (t *remotekvTxn) gets(keys ...[]byte) [][]byte {
+	return t.tx.Gets(keys...)
+}
+
+func (t *remotekvTxn) scanRange(begin, end []byte) map[string][]byte {
+	return t.tx.ScanRange(begin, end)
+}
+
+func (t *remotekvTxn) nextKey(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	next := make([]byte, len(key))
+	copy(next, key)
+	p := len(next) - 1
+	for {
+		next[p]++
+		if next[p] != 0 {
+			break
+		}
+		p--
+		if p < 0 {
+			panic("can't scan keys for 0xFF")
+		}
+	}
+	return next
+}
+
+func (t *remotekvTxn) scanKeys(prefix []byte) [][]byte {
+	var keys [][]byte
+	for k := range t.scanValues(prefix, nil) {
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+func (t *remotekvTxn) scanValues(prefix []byte, filter func(k, v []byte) bool) map[string][]byte {
+	kvs := t.tx.ScanRange(prefix, t.nextKey(prefix))
+	if filter == nil {
+		return kvs
+	}
+	ret := make(map[string][]byte, len(kvs))
+	for k, v := range kvs {
+		if filter([]byte(k), v) {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+func (t *remotekvTxn) exist(prefix []byte) bool {
+	return t.tx.Exist(prefix)
+}
+
+func (t *remotekvTxn) set(key, value []byte) {
+	t.tx.Set(key, value)
+}
+
+func (t *remotekvTxn) append(key []byte, value []byte) []byte {
+	return t.tx.Append(key, value)
+}
+
+func (t *remotekvTxn) incrBy(key []byte, value int64) int64 {
+	return t.tx.IncrBy(key, value)
+}
+
+func (t *remotekvTxn) dels(keys ...[]byte) {
+	t.tx.Dels(keys...)
+}
+
+// localAdapter lets the remotekv server binary expose any existing
+// tkvClient (leveldb, rocksdb, badger, ...) over gRPC by narrowing its
+// txn(f func(kvTxn) error) down to remotekv.Local's smaller surface.
+type localAdapter struct {
+	c tkvClient
+}
+
+// NewRemotekvServer wraps any registered tkvClient so it can be served
+// over gRPC by remotekv.Serve.
+func NewRemotekvServer(c tkvClient) *remotekv.Server {
+	return remotekv.NewServer(&localAdapter{c})
+}
+
+func (a *localAdapter) Txn(f func(tx remotekv.KVTxn) error) error {
+	return a.c.txn(func(tx kvTxn) error {
+		return f(&kvTxnAdapter{tx})
+	})
+}
+
+// singleAttemptTxn is implemented by the backends in this package whose
+// txn(f) retries internally (leveldb, badger, memkv); it exposes one
+// non-retrying attempt for TxnOnce. rocksdb also implements it, as a
+// thin alias for txn, since its txn(f) already never retries.
+type singleAttemptTxn interface {
+	txnOnce(f func(kvTxn) error) error
+}
+
+func (a *localAdapter) TxnOnce(f func(tx remotekv.KVTxn) error) error {
+	once, ok := a.c.(singleAttemptTxn)
+	if !ok {
+		return a.Txn(f)
+	}
+	return once.txnOnce(func(tx kvTxn) error {
+		return f(&kvTxnAdapter{tx})
+	})
+}
+
+// kvTxnAdapter exposes a kvTxn's unexported methods under the exported
+// names remotekv.KVTxn requires, since that interface is implemented
+// outside package meta.
+type kvTxnAdapter struct {
+	tx kvTxn
+}
+
+func (a *kvTxnAdapter) Get(key []byte) []byte { return a.tx.get(key) }
+
+func (a *kvTxnAdapter) Gets(keys ...[]byte) [][]byte { return a.tx.gets(keys...) }
+
+func (a *kvTxnAdapter) ScanRange(begin, end []byte) map[string][]byte {
+	return a.tx.scanRange(begin, end)
+}
+
+func (a *kvTxnAdapter) Exist(prefix []byte) bool { return a.tx.exist(prefix) }
+
+func (a *kvTxnAdapter) Set(key, value []byte) { a.tx.set(key, value) }
+
+func (a *kvTxnAdapter) Append(key []byte, value []byte) []byte { return a.tx.append(key, value) }
+
+func (a *kvTxnAdapter) IncrBy(key []byte, value int64) int64 { return a.tx.incrBy(key, value) }
+
+func (a *kvTxnAdapter) Dels(keys ...[]byte) { a.tx.dels(keys...) }
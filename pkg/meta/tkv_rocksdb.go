@@ -30,6 +30,7 @@ type rocksdbClient struct {
 }
 
 func newRocksdbClient(addr string) (tkvClient, error) {
+	addr, prefix := splitPrefix(addr)
 	opts := grocksdb.NewDefaultOptions()
 	opts.SetCreateIfMissing(true)
 	opts.SetCompression(grocksdb.NoCompression)
@@ -41,13 +42,27 @@ func newRocksdbClient(addr string) (tkvClient, error) {
 	opts.SetBlockBasedTableFactory(bbto)
 	opts.SetPrefixExtractor(grocksdb.NewFixedPrefixTransform(9)) // Aiiiiiiii
 	db, err := grocksdb.OpenOptimisticTransactionDb(opts, addr)
-	return &rocksdbClient{db}, err
+	if err != nil {
+		return nil, err
+	}
+	var c tkvClient = &rocksdbClient{db}
+	if prefix != nil {
+		c = withPrefix(c, prefix)
+	}
+	return withThrottle(c, currentThrottle()), nil
 }
 
 func (c *rocksdbClient) name() string {
 	return "rocksdb"
 }
 
+// txnOnce is an alias for txn: the rocksdb backend never retries
+// internally (OptimisticTransactionDB.Commit just fails on conflict),
+// so it's already a single, non-retrying attempt.
+func (c *rocksdbClient) txnOnce(f func(kvTxn) error) error {
+	return c.txn(f)
+}
+
 func (c *rocksdbClient) txn(f func(kvTxn) error) error {
 	wo := grocksdb.NewDefaultWriteOptions()
 	ro := grocksdb.NewDefaultReadOptions()
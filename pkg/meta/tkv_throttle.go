@@ -0,0 +1,298 @@
+/*
+ * JuiceFS, Copyright (C) 2021 Juicedata, Inc.
+ *
+ * This program is free software: you can use, redistribute, and/or modify
+ * it under the terms of the GNU Affero General Public License, version 3
+ * or later ("AGPL"), as published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Throttle holds the per-operation and per-byte rate limits applied by
+// withThrottle. A zero value (or a nil *Throttle) means unlimited. It is
+// installed with SetThrottle; no mount flag populates it.
+type Throttle struct {
+	ReadQPS  int64
+	WriteQPS int64
+	ReadBPS  int64
+	WriteBPS int64
+}
+
+func (t *Throttle) empty() bool {
+	return t == nil || (t.ReadQPS == 0 && t.WriteQPS == 0 && t.ReadBPS == 0 && t.WriteBPS == 0)
+}
+
+var (
+	currentThrottleMu sync.Mutex
+	currentThrottleV  *Throttle
+)
+
+// SetThrottle installs the rate limits that every subsequently-opened
+// embedded or remote tkvClient is wrapped with via withThrottle; clients
+// opened before the call are not affected. Nothing in the mount path
+// calls it, so limits apply only where a caller invokes it before
+// opening a backend.
+func SetThrottle(t *Throttle) {
+	currentThrottleMu.Lock()
+	defer currentThrottleMu.Unlock()
+	currentThrottleV = t
+}
+
+func currentThrottle() *Throttle {
+	currentThrottleMu.Lock()
+	defer currentThrottleMu.Unlock()
+	return currentThrottleV
+}
+
+// withThrottle wraps a tkvClient with token-bucket rate limits, so one
+// JuiceFS instance can't monopolize a shared embedded or remote meta
+// store. Every operation runs inside a txn, which tallies the ops and
+// bytes its operations use and pays the whole tally in one shot once
+// it has committed, so a single transaction can't burst past the limit
+// by splitting work across many small operations.
+func withThrottle(c tkvClient, t *Throttle) tkvClient {
+	if t.empty() {
+		return c
+	}
+	return &throttledClient{
+		tkvClient: c,
+		readOps:   newTokenBucket(t.ReadQPS),
+		writeOps:  newTokenBucket(t.WriteQPS),
+		readBytes: newTokenBucket(t.ReadBPS),
+		writeBPS:  newTokenBucket(t.WriteBPS),
+	}
+}
+
+type throttledClient struct {
+	tkvClient
+	readOps   *tokenBucket
+	writeOps  *tokenBucket
+	readBytes *tokenBucket
+	writeBPS  *tokenBucket
+}
+
+// Close forwards to the wrapped backend's Close, if it has one; see
+// prefixClient.Close for why this has to be explicit.
+func (c *throttledClient) Close() error {
+	if closer, ok := c.tkvClient.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// txn charges the buckets exactly once per call, for whichever attempt
+// actually committed: the inner closure may be retried by the wrapped
+// backend on conflict, so the tally is reset at the start of every
+// attempt and pay() only runs after c.tkvClient.txn returns success --
+// otherwise a retried transaction would be billed once per attempt
+// instead of once for the work it actually persisted.
+func (c *throttledClient) txn(f func(kvTxn) error) error {
+	tx := &throttledTxn{client: c}
+	err := c.tkvClient.txn(func(inner kvTxn) error {
+		tx.kvTxn = inner
+		tx.reads, tx.writes, tx.readBytes, tx.writtenBPS = 0, 0, 0, 0
+		return f(tx)
+	})
+	if err == nil {
+		tx.pay()
+	}
+	return err
+}
+
+// txnOnce delegates to the wrapped backend's own single-attempt
+// primitive instead of falling back to the retrying txn above: a
+// caller that asked for TxnOnce (the remotekv server, mid-stream)
+// relies on never being retried, and silently handing it a retrying
+// txn here would reintroduce the stream-replay deadlock txnOnce exists
+// to prevent. There's exactly one attempt, so no per-attempt tally
+// reset is needed -- pay() still runs only if it committed.
+func (c *throttledClient) txnOnce(f func(kvTxn) error) error {
+	once, ok := c.tkvClient.(singleAttemptTxn)
+	if !ok {
+		panic(fmt.Sprintf("throttledClient: wrapped %T does not support txnOnce", c.tkvClient))
+	}
+	tx := &throttledTxn{client: c}
+	err := once.txnOnce(func(inner kvTxn) error {
+		tx.kvTxn = inner
+		return f(tx)
+	})
+	if err == nil {
+		tx.pay()
+	}
+	return err
+}
+
+// throttledTxn wraps the inner kvTxn, tallying the bytes/ops charged by
+// each call and only drawing from the client's buckets once, at pay().
+type throttledTxn struct {
+	kvTxn
+	client *throttledClient
+
+	reads, writes         int64
+	readBytes, writtenBPS int64
+}
+
+func (tx *throttledTxn) pay() {
+	tx.client.readOps.charge(tx.reads)
+	tx.client.writeOps.charge(tx.writes)
+	tx.client.readBytes.charge(tx.readBytes)
+	tx.client.writeBPS.charge(tx.writtenBPS)
+}
+
+func kvSize(kvs map[string][]byte) int64 {
+	var n int64
+	for k, v := range kvs {
+		n += int64(len(k) + len(v))
+	}
+	return n
+}
+
+func (tx *throttledTxn) get(key []byte) []byte {
+	tx.reads++
+	v := tx.kvTxn.get(key)
+	tx.readBytes += int64(len(key) + len(v))
+	return v
+}
+
+func (tx *throttledTxn) gets(keys ...[]byte) [][]byte {
+	tx.reads++
+	vs := tx.kvTxn.gets(keys...)
+	for i, v := range vs {
+		tx.readBytes += int64(len(keys[i]) + len(v))
+	}
+	return vs
+}
+
+func (tx *throttledTxn) scanRange(begin, end []byte) map[string][]byte {
+	tx.reads++
+	kvs := tx.kvTxn.scanRange(begin, end)
+	tx.readBytes += kvSize(kvs)
+	return kvs
+}
+
+func (tx *throttledTxn) scanKeys(prefix []byte) [][]byte {
+	tx.reads++
+	keys := tx.kvTxn.scanKeys(prefix)
+	for _, k := range keys {
+		tx.readBytes += int64(len(k))
+	}
+	return keys
+}
+
+func (tx *throttledTxn) scanValues(prefix []byte, filter func(k, v []byte) bool) map[string][]byte {
+	tx.reads++
+	kvs := tx.kvTxn.scanValues(prefix, filter)
+	tx.readBytes += kvSize(kvs)
+	return kvs
+}
+
+func (tx *throttledTxn) exist(prefix []byte) bool {
+	tx.reads++
+	return tx.kvTxn.exist(prefix)
+}
+
+func (tx *throttledTxn) set(key, value []byte) {
+	tx.writes++
+	tx.writtenBPS += int64(len(key) + len(value))
+	tx.kvTxn.set(key, value)
+}
+
+func (tx *throttledTxn) append(key []byte, value []byte) []byte {
+	tx.writes++
+	tx.writtenBPS += int64(len(key) + len(value))
+	return tx.kvTxn.append(key, value)
+}
+
+func (tx *throttledTxn) incrBy(key []byte, value int64) int64 {
+	tx.writes++
+	tx.writtenBPS += int64(len(key) + 8)
+	return tx.kvTxn.incrBy(key, value)
+}
+
+func (tx *throttledTxn) dels(keys ...[]byte) {
+	tx.writes++
+	for _, k := range keys {
+		tx.writtenBPS += int64(len(k))
+	}
+	tx.kvTxn.dels(keys...)
+}
+
+// tokenBucket is a simple blocking token-bucket rate limiter: tokens
+// are refilled continuously at qps per second up to a small burst, and
+// charge(n) blocks until n tokens are available. A nil or zero-qps
+// bucket never blocks.
+type tokenBucket struct {
+	qps int64
+
+	mu       sync.Mutex
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(qps int64) *tokenBucket {
+	if qps <= 0 {
+		return nil
+	}
+	return &tokenBucket{qps: qps, lastFill: time.Now()}
+}
+
+// refill tops up tokens based on elapsed time since the last call,
+// capping the burst at one second's worth of tokens.
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastFill).Seconds()
+	b.lastFill = now
+	b.tokens += elapsed * float64(b.qps)
+	if max := float64(b.qps); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+// charge blocks until n tokens have been drawn from the bucket, in
+// doses of at most one second's worth of tokens per iteration (the
+// burst cap refill enforces) -- so it makes progress on every
+// iteration and completes in roughly n/qps seconds even when n is
+// larger than the bucket's capacity. A single charge(n) that demanded
+// all n tokens at once, as the bucket's burst cap requires, would
+// never unblock for any n bigger than qps.
+func (b *tokenBucket) charge(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	remaining := float64(n)
+	for remaining > 0 {
+		b.mu.Lock()
+		b.refill(time.Now())
+		take := b.tokens
+		if take > remaining {
+			take = remaining
+		}
+		b.tokens -= take
+		remaining -= take
+		qps := b.qps
+		b.mu.Unlock()
+		if remaining <= 0 {
+			return
+		}
+		wait := time.Duration(remaining) * time.Second / time.Duration(qps)
+		if wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		} else if wait <= 0 {
+			wait = time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}